@@ -3,23 +3,60 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"plugin"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
-	_ "github.com/ncruces/go-sqlite3/driver"
+	"github.com/chzyer/readline"
+	"github.com/dop251/goja"
+	"github.com/ncruces/go-sqlite3"
+	"github.com/ncruces/go-sqlite3/driver"
 	_ "github.com/ncruces/go-sqlite3/embed"
 	"github.com/olekukonko/tablewriter"
+	"gopkg.in/yaml.v3"
 )
 
+// backupStepPages is the number of pages copied per backup step, chosen so that
+// progress is reported often without adding per-page overhead.
+const backupStepPages = 100
+
+const (
+	formatTable  = "table"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+	formatTSV    = "tsv"
+)
+
+var supportedFormats = []string{formatTable, formatJSON, formatNDJSON, formatCSV, formatTSV}
+
+// resultEnvelope is the machine-readable shape emitted for -format json/ndjson,
+// one per -query/-exec call, similar to rqlite's HTTP response envelope.
+type resultEnvelope struct {
+	Columns      []string `json:"columns,omitempty"`
+	Types        []string `json:"types,omitempty"`
+	Rows         [][]any  `json:"rows,omitempty"`
+	RowsAffected *int64   `json:"rows_affected,omitempty"`
+	LastInsertID *int64   `json:"last_insert_id,omitempty"`
+	TimeMs       int64    `json:"time_ms"`
+}
+
 const help = `
 SQLite3 query and exec multitool.
 
--exec and -query calls are executed on one transaction.
+-exec, -query, -fixture and -import all run on one transaction, in the
+order they appear on the command line.
 
 Example invocations:
 
@@ -47,6 +84,8 @@ The following SQLite3 exts are compiled in:
 type sqlCall struct {
 	query, exec string
 	args        []any
+	fixture     string
+	importSpec  *importSpec
 }
 
 func main() {
@@ -112,7 +151,7 @@ func main() {
 				return fmt.Errorf("parsing SQL argument: %w", err)
 			}
 
-			if len(calls) == 0 {
+			if len(calls) == 0 || (calls[len(calls)-1].query == "" && calls[len(calls)-1].exec == "") {
 				return errors.New("-arg is set before -query or -exec - can't set argument. Use like following: -query `select $1` -arg 10:integer")
 			}
 
@@ -132,6 +171,63 @@ func main() {
 	dbFile := ""
 	flag.StringVar(&dbFile, "db", dbFile, "Database file to use")
 
+	backupDest := ""
+	flag.StringVar(&backupDest, "backup", backupDest, "Backup the opened -db into the given file using the online backup API")
+
+	restoreSrc := ""
+	flag.StringVar(&restoreSrc, "restore", restoreSrc, "Restore the opened -db from the given file using the online backup API")
+
+	format := formatTable
+	flag.StringVar(&format, "format", format, "Output format for query/exec results: "+strings.Join(supportedFormats, ", "))
+
+	flag.Func("fixture", "path to a YAML/JSON fixture file, or a directory of them, to load in command-line order with -query/-exec/-import", func(path string) error {
+		if strings.TrimSpace(path) != "" {
+			calls = append(calls, sqlCall{fixture: path})
+		}
+		return nil
+	})
+
+	fixtureClean := false
+	flag.BoolVar(&fixtureClean, "fixture-clean", fixtureClean, "Delete existing rows from each fixture table before inserting")
+
+	repl := false
+	flag.BoolVar(&repl, "repl", repl, "Drop into an interactive shell after running the -query/-exec/-fixture calls")
+
+	var funcPlugins []pluginSpec
+	flag.Func("func", "register a Go plugin as a SQL function: name=path/to/plugin.so, exporting Scalar or Step/Final", func(spec string) error {
+		p, err := parsePluginSpec(spec)
+		if err != nil {
+			return err
+		}
+		funcPlugins = append(funcPlugins, p)
+		return nil
+	})
+
+	var jsPlugins []pluginSpec
+	flag.Func("js", "register an embedded JS SQL function: name=path/to/script.js, exporting a Scalar(...args) function", func(spec string) error {
+		p, err := parsePluginSpec(spec)
+		if err != nil {
+			return err
+		}
+		jsPlugins = append(jsPlugins, p)
+		return nil
+	})
+
+	flag.Func("import", "stream rows into a table: file=path,table=name[,format=csv|tsv|ndjson][,header=true|false]", func(spec string) error {
+		s, err := parseImportSpec(spec)
+		if err != nil {
+			return err
+		}
+		calls = append(calls, sqlCall{importSpec: &s})
+		return nil
+	})
+
+	importBatch := 1000
+	flag.IntVar(&importBatch, "import-batch", importBatch, "Rows per SAVEPOINT batch for -import")
+
+	importNullString := ""
+	flag.StringVar(&importNullString, "import-null-string", importNullString, "Field value treated as SQL NULL during -import; unset (the default) disables null substitution")
+
 	flag.Usage = func() {
 		fmt.Println(help)
 		flag.PrintDefaults()
@@ -144,12 +240,41 @@ func main() {
 		panic("no database file specified")
 	}
 
+	if !slices.Contains(supportedFormats, format) {
+		panic(fmt.Sprintf("unknown -format %q, supported: %s", format, strings.Join(supportedFormats, ", ")))
+	}
+
+	if importBatch <= 0 {
+		panic("-import-batch must be positive")
+	}
+
 	db, err := sql.Open("sqlite3", "file:"+dbFile)
 	if err != nil {
 		panic("database open:" + err.Error())
 	}
 	defer db.Close()
 
+	if len(funcPlugins) > 0 || len(jsPlugins) > 0 {
+		// Function registration is per-connection, so pin the pool to a single
+		// connection and register on it before anything else borrows it.
+		db.SetMaxOpenConns(1)
+		if err := registerPlugins(ctx, db, funcPlugins, jsPlugins); err != nil {
+			panic("registering functions: " + err.Error())
+		}
+	}
+
+	if backupDest != "" {
+		if err := backupTo(ctx, db, backupDest); err != nil {
+			panic("backup: " + err.Error())
+		}
+	}
+
+	if restoreSrc != "" {
+		if err := restoreFrom(ctx, restoreSrc, dbFile); err != nil {
+			panic("restore: " + err.Error())
+		}
+	}
+
 	tx, err := db.Begin()
 	if err != nil {
 		panic("opening connections: " + err.Error())
@@ -158,16 +283,28 @@ func main() {
 
 	for _, call := range calls {
 		switch {
+		case call.fixture != "":
+			if err := loadFixtures(ctx, tx, call.fixture, fixtureClean); err != nil {
+				panic("fixture: " + err.Error())
+			}
+		case call.importSpec != nil:
+			if err := runImport(ctx, tx, *call.importSpec, importBatch, importNullString); err != nil {
+				panic("import: " + err.Error())
+			}
 		case call.exec != "":
-			fmt.Println(">", call.exec)
+			if format == formatTable {
+				fmt.Println(">", call.exec)
+			}
+			start := time.Now()
 			result, err := tx.ExecContext(ctx, call.exec, call.args...)
 			if err != nil {
 				panic("exec: " + err.Error())
 			}
-			fmt.Printf("rows affected: ")
-			fmt.Println(result.RowsAffected())
+			if err := printExecResult(format, result, time.Since(start)); err != nil {
+				panic("exec: " + err.Error())
+			}
 		case call.query != "":
-			if err := runQuery(ctx, tx, call.query, call.args); err != nil {
+			if err := runQuery(ctx, tx, call.query, call.args, format); err != nil {
 				panic(err)
 			}
 		default:
@@ -175,13 +312,32 @@ func main() {
 		}
 	}
 
+	if repl {
+		if err := runREPL(ctx, db, tx, &format); err != nil {
+			panic("repl: " + err.Error())
+		}
+		return
+	}
+
 	if err := tx.Commit(); err != nil {
 		panic("commit: " + err.Error())
 	}
 }
 
-func runQuery(ctx context.Context, db *sql.Tx, query string, args []any) error {
-	fmt.Println("> ", query)
+// sqlExecQueryer is satisfied by both *sql.DB and *sql.Tx, letting query/exec
+// helpers work inside an explicit transaction or directly against the database.
+type sqlExecQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func runQuery(ctx context.Context, db sqlExecQueryer, query string, args []any, format string) error {
+	if format == formatTable {
+		fmt.Println("> ", query)
+	}
+
+	start := time.Now()
 
 	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -198,8 +354,12 @@ func runQuery(ctx context.Context, db *sql.Tx, query string, args []any) error {
 		return nil
 	}
 
-	tw := tablewriter.NewWriter(os.Stdout)
-	tw.Header(columns)
+	types := make([]string, len(columns))
+	if columnTypes, err := rows.ColumnTypes(); err == nil {
+		for i, ct := range columnTypes {
+			types[i] = ct.DatabaseTypeName()
+		}
+	}
 
 	row := make([]any, len(columns))
 	rowValues := make([]any, len(columns))
@@ -207,16 +367,1311 @@ func runQuery(ctx context.Context, db *sql.Tx, query string, args []any) error {
 		rowValues[i] = &row[i]
 	}
 
+	var result [][]any
 	for rows.Next() {
 		if err := rows.Scan(rowValues...); err != nil {
 			return fmt.Errorf("reading result %w", err)
 		}
 
-		tw.Append(row)
+		result = append(result, slices.Clone(row))
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	switch format {
+	case formatJSON, formatNDJSON:
+		return printEnvelope(format, resultEnvelope{
+			Columns: columns,
+			Types:   types,
+			Rows:    result,
+			TimeMs:  time.Since(start).Milliseconds(),
+		})
+	case formatCSV:
+		return writeDelimited(os.Stdout, ',', columns, result)
+	case formatTSV:
+		return writeDelimited(os.Stdout, '\t', columns, result)
+	default:
+		tw := tablewriter.NewWriter(os.Stdout)
+		tw.Header(columns)
+		for _, row := range result {
+			tw.Append(row)
+		}
+		return tw.Render()
+	}
+}
+
+// printExecResult reports the outcome of an -exec call in the requested -format.
+func printExecResult(format string, result sql.Result, elapsed time.Duration) error {
+	switch format {
+	case formatJSON, formatNDJSON:
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		lastInsertID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		return printEnvelope(format, resultEnvelope{
+			RowsAffected: &rowsAffected,
+			LastInsertID: &lastInsertID,
+			TimeMs:       elapsed.Milliseconds(),
+		})
+	default:
+		fmt.Printf("rows affected: ")
+		fmt.Println(result.RowsAffected())
+		return nil
+	}
+}
+
+// printEnvelope writes env as a single JSON object. For ndjson it is written
+// compact on one line; for json it is pretty-printed for human inspection.
+func printEnvelope(format string, env resultEnvelope) error {
+	enc := json.NewEncoder(os.Stdout)
+	if format == formatJSON {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(env)
+}
+
+// writeDelimited renders columns and rows as CSV/TSV, coercing nil to an empty
+// field and []byte to its raw string contents.
+func writeDelimited(w *os.File, comma rune, columns []string, rows [][]any) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+
+	record := make([]string, len(columns))
+	for _, row := range rows {
+		for i, v := range row {
+			record[i] = formatCSVValue(v)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatCSVValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// backupTo copies db into destFile using the online backup API, allowing other
+// statements to keep running against db while the copy is in progress.
+func backupTo(ctx context.Context, db *sql.DB, destFile string) error {
+	return runBackup(ctx, db, "file:"+destFile)
+}
+
+// restoreFrom overwrites destFile with the contents of srcFile using the online
+// backup API. destFile is the path the main -db connection was opened with; it
+// is reopened here as its own connection since BackupInit always drives a
+// backup from a live source connection onto a destination URI.
+func restoreFrom(ctx context.Context, srcFile, destFile string) error {
+	srcDB, err := sql.Open("sqlite3", "file:"+srcFile)
+	if err != nil {
+		return fmt.Errorf("opening restore source: %w", err)
+	}
+	defer srcDB.Close()
+
+	return runBackup(ctx, srcDB, "file:"+destFile)
+}
+
+// runBackup drives an SQLite online backup from the "main" database of src into
+// dstURI, reporting progress after every step until the whole database has
+// been copied.
+func runBackup(ctx context.Context, src *sql.DB, dstURI string) error {
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("acquiring source connection: %w", err)
+	}
+	defer srcConn.Close()
+
+	var backup *sqlite3.Backup
+	err = srcConn.Raw(func(srcDriverConn any) error {
+		backup, err = srcDriverConn.(driver.Conn).Raw().BackupInit("main", dstURI)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("initializing backup: %w", err)
+	}
+	defer backup.Close()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		done, err := backup.Step(backupStepPages)
+		if err != nil {
+			return fmt.Errorf("backup step: %w", err)
+		}
+
+		fmt.Printf("backup: %d pages remaining / %d total\n", backup.Remaining(), backup.PageCount())
+
+		if done {
+			break
+		}
+	}
+
+	return nil
+}
+
+// loadFixtures reads path, a single YAML/JSON fixture file or a directory of them,
+// and inserts the rows it describes into tx.
+func loadFixtures(ctx context.Context, tx *sql.Tx, path string, clean bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", path, err)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return fmt.Errorf("reading fixture dir %s: %w", path, err)
+		}
+
+		files = files[:0]
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			switch filepath.Ext(entry.Name()) {
+			case ".yaml", ".yml", ".json":
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+		slices.Sort(files)
+	}
+
+	for _, file := range files {
+		if err := loadFixtureFile(ctx, tx, file, clean); err != nil {
+			return fmt.Errorf("loading fixture %s: %w", file, err)
+		}
+	}
+
+	return nil
+}
+
+// loadFixtureFile parses a single fixture document mapping table name to a list
+// of row objects, and inserts those rows into tx.
+func loadFixtureFile(ctx context.Context, tx *sql.Tx, file string, clean bool) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	tables := map[string][]map[string]any{}
+	switch filepath.Ext(file) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &tables); err != nil {
+			return fmt.Errorf("parsing YAML: %w", err)
+		}
+	case ".json":
+		if err := json.Unmarshal(data, &tables); err != nil {
+			return fmt.Errorf("parsing JSON: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported fixture extension %q", filepath.Ext(file))
+	}
+
+	tableNames := make([]string, 0, len(tables))
+	for name := range tables {
+		tableNames = append(tableNames, name)
+	}
+	slices.Sort(tableNames)
+
+	for _, table := range tableNames {
+		if err := insertFixtureRows(ctx, tx, table, tables[table], clean); err != nil {
+			return fmt.Errorf("table %s: %w", table, err)
+		}
+	}
+
+	return nil
+}
+
+// insertFixtureRows inserts rows into table, coercing values to the column's
+// declared affinity as reported by PRAGMA table_info.
+func insertFixtureRows(ctx context.Context, db sqlExecQueryer, table string, rows []map[string]any, clean bool) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	if clean {
+		if _, err := db.ExecContext(ctx, "DELETE FROM "+quoteIdent(table)); err != nil {
+			return fmt.Errorf("cleaning table: %w", err)
+		}
+	}
+
+	columnTypes, err := tableColumnTypes(ctx, db, table)
+	if err != nil {
+		return fmt.Errorf("introspecting columns: %w", err)
+	}
+
+	for _, row := range rows {
+		columnNames := make([]string, 0, len(row))
+		for name := range row {
+			columnNames = append(columnNames, name)
+		}
+		slices.Sort(columnNames)
+
+		columns := make([]string, len(columnNames))
+		placeholders := make([]string, len(columnNames))
+		values := make([]any, len(columnNames))
+		for i, name := range columnNames {
+			value, err := coerceFixtureValue(row[name], columnTypes[name])
+			if err != nil {
+				return fmt.Errorf("column %s: %w", name, err)
+			}
+
+			columns[i] = quoteIdent(name)
+			placeholders[i] = "?"
+			values[i] = value
+		}
+
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+			quoteIdent(table), strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+
+		if _, err := db.ExecContext(ctx, query, values...); err != nil {
+			return fmt.Errorf("inserting row: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// tableColumnTypes returns the declared type of each column of table, as
+// reported by PRAGMA table_info.
+func tableColumnTypes(ctx context.Context, db sqlExecQueryer, table string) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, "PRAGMA table_info("+quoteIdent(table)+")")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types := map[string]string{}
+	for rows.Next() {
+		var cid, notnull, pk int
+		var name, columnType string
+		var dflt any
+		if err := rows.Scan(&cid, &name, &columnType, &notnull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		types[name] = strings.ToUpper(columnType)
+	}
+
+	return types, rows.Err()
+}
+
+// coerceFixtureValue converts a value decoded from a YAML/JSON fixture to the Go
+// type matching columnType's SQLite affinity, so that e.g. a quoted "10" in YAML
+// is inserted as an INTEGER rather than TEXT.
+func coerceFixtureValue(value any, columnType string) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	s, isString := value.(string)
+
+	switch {
+	case strings.Contains(columnType, "INT"):
+		if !isString {
+			return value, nil
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %q as INTEGER: %w", s, err)
+		}
+		return n, nil
+	case strings.Contains(columnType, "REAL") || strings.Contains(columnType, "FLOA") || strings.Contains(columnType, "DOUB"):
+		if !isString {
+			return value, nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %q as REAL: %w", s, err)
+		}
+		return f, nil
+	case strings.Contains(columnType, "BLOB"):
+		if isString {
+			return []byte(s), nil
+		}
+		return value, nil
+	default:
+		return value, nil
+	}
+}
+
+// quoteIdent quotes name as an SQLite identifier, doubling any embedded quotes.
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// errQuit signals that a dot-command asked the REPL to stop.
+var errQuit = errors.New("quit")
+
+// runREPL drops into an interactive shell running statements against tx, until
+// the user quits or EOF is reached on stdin. It owns tx: .commit/.rollback end
+// it, .begin opens a new one, and on exit any still-open transaction is committed.
+func runREPL(ctx context.Context, db *sql.DB, tx *sql.Tx, format *string) error {
+	historyFile := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		historyFile = filepath.Join(home, ".sql3effect_history")
+	}
+
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:      "sql3effect> ",
+		HistoryFile: historyFile,
+	})
+	if err != nil {
+		return fmt.Errorf("starting REPL: %w", err)
+	}
+	defer rl.Close()
+
+	var buf strings.Builder
+	for {
+		if buf.Len() == 0 {
+			rl.SetPrompt("sql3effect> ")
+		} else {
+			rl.SetPrompt("        ...> ")
+		}
+
+		line, err := rl.Readline()
+		switch {
+		case errors.Is(err, readline.ErrInterrupt):
+			buf.Reset()
+			continue
+		case errors.Is(err, io.EOF):
+			if tx != nil {
+				return tx.Commit()
+			}
+			return nil
+		case err != nil:
+			return err
+		}
+
+		trimmed := strings.TrimSpace(line)
+
+		if buf.Len() == 0 && strings.HasPrefix(trimmed, ".") {
+			tx, err = runDotCommand(ctx, db, tx, format, trimmed)
+			if errors.Is(err, errQuit) {
+				if tx != nil {
+					return tx.Commit()
+				}
+				return nil
+			}
+			if err != nil {
+				fmt.Println("error:", err)
+			}
+			continue
+		}
+
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+
+		if !strings.HasSuffix(trimmed, ";") {
+			continue
+		}
+
+		statement := buf.String()
+		buf.Reset()
+
+		if tx == nil {
+			tx, err = db.Begin()
+			if err != nil {
+				fmt.Println("error: beginning transaction:", err)
+				continue
+			}
+		}
+
+		if err := execStatement(ctx, tx, statement, *format); err != nil {
+			fmt.Println("error:", err)
+		}
+	}
+}
+
+// execStatement runs a single REPL statement, dispatching it as a query or an
+// exec based on its leading keyword.
+func execStatement(ctx context.Context, db sqlExecQueryer, statement string, format string) error {
+	statement = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(statement), ";"))
+	if statement == "" {
+		return nil
+	}
+
+	if looksLikeQuery(statement) {
+		return runQuery(ctx, db, statement, nil, format)
+	}
+
+	start := time.Now()
+	result, err := db.ExecContext(ctx, statement)
+	if err != nil {
+		return err
+	}
+	return printExecResult(format, result, time.Since(start))
+}
+
+func looksLikeQuery(statement string) bool {
+	word, _, _ := strings.Cut(strings.TrimSpace(statement), " ")
+	switch strings.ToUpper(word) {
+	case "SELECT", "WITH", "PRAGMA", "EXPLAIN", "VALUES":
+		return true
+	default:
+		return false
+	}
+}
+
+// runDotCommand runs a sqlite3-shell-style dot-command, returning the (possibly
+// replaced) transaction that future statements should use.
+func runDotCommand(ctx context.Context, db *sql.DB, tx *sql.Tx, format *string, line string) (*sql.Tx, error) {
+	fields := strings.Fields(line)
+	cmd, args := fields[0], fields[1:]
+
+	execer := currentExecer(db, tx)
+
+	switch cmd {
+	case ".quit", ".exit":
+		return tx, errQuit
+
+	case ".tables":
+		return tx, runQuery(ctx, execer, "SELECT name FROM sqlite_master WHERE type='table' ORDER BY name", nil, *format)
+
+	case ".schema":
+		query := "SELECT sql FROM sqlite_master WHERE sql IS NOT NULL"
+		var qargs []any
+		if len(args) > 0 {
+			query += " AND name = ?"
+			qargs = append(qargs, args[0])
+		}
+		query += " ORDER BY name"
+		return tx, runQuery(ctx, execer, query, qargs, *format)
+
+	case ".mode":
+		if len(args) != 1 || !slices.Contains(supportedFormats, args[0]) {
+			return tx, fmt.Errorf("usage: .mode {%s}", strings.Join(supportedFormats, ","))
+		}
+		*format = args[0]
+		return tx, nil
+
+	case ".import":
+		if len(args) != 2 {
+			return tx, errors.New("usage: .import file.csv table")
+		}
+		return tx, importCSVFile(ctx, execer, args[0], args[1])
+
+	case ".dump":
+		return tx, dumpDatabase(ctx, execer)
+
+	case ".backup":
+		if len(args) != 1 {
+			return tx, errors.New("usage: .backup file")
+		}
+		return tx, backupTo(ctx, db, args[0])
+
+	case ".begin":
+		if tx != nil {
+			return tx, errors.New("a transaction is already open")
+		}
+		newTx, err := db.Begin()
+		return newTx, err
+
+	case ".commit":
+		if tx == nil {
+			return tx, errors.New("no transaction is open")
+		}
+		return nil, tx.Commit()
+
+	case ".rollback":
+		if tx == nil {
+			return tx, errors.New("no transaction is open")
+		}
+		return nil, tx.Rollback()
+
+	default:
+		return tx, fmt.Errorf("unknown dot-command %q", cmd)
+	}
+}
+
+// currentExecer returns tx if a transaction is open, otherwise db itself, so
+// dot-commands work whether or not a transaction has been started.
+func currentExecer(db *sql.DB, tx *sql.Tx) sqlExecQueryer {
+	if tx != nil {
+		return tx
+	}
+	return db
+}
+
+// importCSVFile streams file's rows into table using its header row for column
+// names and PRAGMA table_info for type coercion, modeled on sqlite3's .import.
+func importCSVFile(ctx context.Context, db sqlExecQueryer, file, table string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cr := csv.NewReader(f)
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+
+	columnTypes, err := tableColumnTypes(ctx, db, table)
+	if err != nil {
+		return fmt.Errorf("introspecting columns: %w", err)
+	}
+
+	quoted := make([]string, len(header))
+	placeholders := make([]string, len(header))
+	for i, name := range header {
+		quoted[i] = quoteIdent(name)
+		placeholders[i] = "?"
+	}
+	insertStmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		quoteIdent(table), strings.Join(quoted, ", "), strings.Join(placeholders, ", "))
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		values := make([]any, len(record))
+		for i, field := range record {
+			value, err := coerceFixtureValue(field, columnTypes[header[i]])
+			if err != nil {
+				return fmt.Errorf("column %s: %w", header[i], err)
+			}
+			values[i] = value
+		}
+
+		if _, err := db.ExecContext(ctx, insertStmt, values...); err != nil {
+			return fmt.Errorf("inserting row: %w", err)
+		}
+	}
+}
+
+// dumpDatabase writes a plain-text SQL dump of db's schema and contents to
+// stdout, modeled on sqlite3's .dump.
+func dumpDatabase(ctx context.Context, db sqlExecQueryer) error {
+	fmt.Println("BEGIN TRANSACTION;")
+
+	schemaRows, err := db.QueryContext(ctx,
+		"SELECT type, name, sql FROM sqlite_master WHERE sql IS NOT NULL ORDER BY type = 'table' DESC, name")
+	if err != nil {
+		return err
+	}
+
+	var tables []string
+	for schemaRows.Next() {
+		var kind, name, schema string
+		if err := schemaRows.Scan(&kind, &name, &schema); err != nil {
+			schemaRows.Close()
+			return err
+		}
+		fmt.Println(schema + ";")
+		if kind == "table" {
+			tables = append(tables, name)
+		}
+	}
+	if err := errors.Join(schemaRows.Err(), schemaRows.Close()); err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if err := dumpTableRows(ctx, db, table); err != nil {
+			return fmt.Errorf("dumping table %s: %w", table, err)
+		}
+	}
+
+	fmt.Println("COMMIT;")
+	return nil
+}
+
+func dumpTableRows(ctx context.Context, db sqlExecQueryer, table string) error {
+	rows, err := db.QueryContext(ctx, "SELECT * FROM "+quoteIdent(table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	row := make([]any, len(columns))
+	rowValues := make([]any, len(columns))
+	for i := range row {
+		rowValues[i] = &row[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(rowValues...); err != nil {
+			return err
+		}
+
+		values := make([]string, len(row))
+		for i, v := range row {
+			values[i] = dumpSQLLiteral(v)
+		}
+
+		fmt.Printf("INSERT INTO %s VALUES(%s);\n", quoteIdent(table), strings.Join(values, ","))
+	}
+
+	return rows.Err()
+}
+
+// dumpSQLLiteral renders v as an SQL literal suitable for a .dump INSERT statement.
+func dumpSQLLiteral(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// pluginSpec is a parsed -func/-js flag value: the SQL function name and the
+// path to the plugin implementing it.
+type pluginSpec struct {
+	name, path string
+}
+
+func parsePluginSpec(spec string) (pluginSpec, error) {
+	name, path, ok := strings.Cut(spec, "=")
+	if !ok || name == "" || path == "" {
+		return pluginSpec{}, fmt.Errorf("invalid plugin spec %q, expected name=path", spec)
+	}
+	return pluginSpec{name: name, path: path}, nil
+}
+
+// registerPlugins loads each Go plugin and JS script and registers the SQL
+// function(s) it exports on db's single pinned connection.
+func registerPlugins(ctx context.Context, db *sql.DB, funcPlugins, jsPlugins []pluginSpec) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("acquiring connection: %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		sqliteConn := driverConn.(driver.Conn).Raw()
+
+		for _, spec := range funcPlugins {
+			if err := registerGoPluginFunction(sqliteConn, spec); err != nil {
+				return fmt.Errorf("-func %s: %w", spec.name, err)
+			}
+		}
+
+		for _, spec := range jsPlugins {
+			if err := registerJSFunction(sqliteConn, spec); err != nil {
+				return fmt.Errorf("-js %s: %w", spec.name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// registerGoPluginFunction loads a Go plugin and registers its exported
+// Scalar, or Step/Final pair, as a SQL function named spec.name.
+func registerGoPluginFunction(conn *sqlite3.Conn, spec pluginSpec) error {
+	p, err := plugin.Open(spec.path)
+	if err != nil {
+		return fmt.Errorf("opening plugin: %w", err)
+	}
+
+	if sym, lookupErr := p.Lookup("Scalar"); lookupErr == nil {
+		scalar, ok := sym.(func(args ...any) (any, error))
+		if !ok {
+			return errors.New(`"Scalar" does not have signature func(args ...any) (any, error)`)
+		}
+
+		return conn.CreateFunction(spec.name, -1, sqlite3.DETERMINISTIC,
+			func(fctx sqlite3.Context, args ...sqlite3.Value) {
+				result, err := scalar(valuesToAny(args)...)
+				if err != nil {
+					fctx.ResultError(err)
+					return
+				}
+				setResult(fctx, result)
+			})
+	}
+
+	stepSym, stepErr := p.Lookup("Step")
+	finalSym, finalErr := p.Lookup("Final")
+	if stepErr != nil || finalErr != nil {
+		return errors.New(`plugin exports neither "Scalar" nor "Step"/"Final"`)
+	}
+
+	step, ok := stepSym.(func(acc any, args ...any) (any, error))
+	if !ok {
+		return errors.New(`"Step" does not have signature func(acc any, args ...any) (any, error)`)
+	}
+	final, ok := finalSym.(func(acc any) (any, error))
+	if !ok {
+		return errors.New(`"Final" does not have signature func(acc any) (any, error)`)
+	}
+
+	return conn.CreateWindowFunction(spec.name, -1, sqlite3.DETERMINISTIC,
+		func() sqlite3.AggregateFunction {
+			return &pluginAggregate{step: step, final: final}
+		})
+}
+
+// registerJSFunction loads a JS script via goja and registers its exported
+// Scalar(...) function as a SQL function named spec.name.
+func registerJSFunction(conn *sqlite3.Conn, spec pluginSpec) error {
+	source, err := os.ReadFile(spec.path)
+	if err != nil {
+		return fmt.Errorf("reading script: %w", err)
+	}
+
+	vm := goja.New()
+	if _, err := vm.RunScript(spec.path, string(source)); err != nil {
+		return fmt.Errorf("running script: %w", err)
+	}
+
+	scalar, ok := goja.AssertFunction(vm.Get("Scalar"))
+	if !ok {
+		return errors.New(`script does not export a "Scalar" function`)
+	}
+
+	return conn.CreateFunction(spec.name, -1, sqlite3.DETERMINISTIC,
+		func(fctx sqlite3.Context, args ...sqlite3.Value) {
+			jsArgs := make([]goja.Value, len(args))
+			for i, v := range valuesToAny(args) {
+				jsArgs[i] = vm.ToValue(v)
+			}
+
+			result, err := scalar(goja.Undefined(), jsArgs...)
+			if err != nil {
+				fctx.ResultError(err)
+				return
+			}
+			setResult(fctx, result.Export())
+		})
+}
+
+// pluginAggregate adapts a plugin's Step/Final pair to sqlite3.AggregateFunction.
+type pluginAggregate struct {
+	acc   any
+	step  func(acc any, args ...any) (any, error)
+	final func(acc any) (any, error)
+}
+
+func (a *pluginAggregate) Step(fctx sqlite3.Context, args ...sqlite3.Value) {
+	acc, err := a.step(a.acc, valuesToAny(args)...)
+	if err != nil {
+		fctx.ResultError(err)
+		return
+	}
+	a.acc = acc
+}
+
+func (a *pluginAggregate) Value(fctx sqlite3.Context) {
+	result, err := a.final(a.acc)
+	if err != nil {
+		fctx.ResultError(err)
+		return
+	}
+	setResult(fctx, result)
+}
+
+// valuesToAny converts SQLite function arguments to plain Go values.
+func valuesToAny(args []sqlite3.Value) []any {
+	out := make([]any, len(args))
+	for i, v := range args {
+		switch v.Type() {
+		case sqlite3.NULL:
+			out[i] = nil
+		case sqlite3.INTEGER:
+			out[i] = v.Int64()
+		case sqlite3.FLOAT:
+			out[i] = v.Float()
+		case sqlite3.BLOB:
+			out[i] = v.Blob(nil)
+		default:
+			out[i] = v.Text()
+		}
+	}
+	return out
+}
+
+// setResult stores a plugin/script result as fctx's SQL function result.
+func setResult(fctx sqlite3.Context, v any) {
+	switch v := v.(type) {
+	case nil:
+		fctx.ResultNull()
+	case bool:
+		fctx.ResultBool(v)
+	case int:
+		fctx.ResultInt(v)
+	case int64:
+		fctx.ResultInt64(v)
+	case float64:
+		fctx.ResultFloat(v)
+	case []byte:
+		fctx.ResultBlob(v)
+	case string:
+		fctx.ResultText(v)
+	default:
+		fctx.ResultText(fmt.Sprint(v))
+	}
+}
+
+// importSpec is a parsed -import flag value.
+type importSpec struct {
+	file, table, format string
+	header              bool
+}
+
+func parseImportSpec(spec string) (importSpec, error) {
+	s := importSpec{header: true}
+
+	for _, field := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return importSpec{}, fmt.Errorf("invalid -import field %q, expected key=value", field)
+		}
+
+		switch key {
+		case "file":
+			s.file = value
+		case "table":
+			s.table = value
+		case "format":
+			s.format = value
+		case "header":
+			header, err := strconv.ParseBool(value)
+			if err != nil {
+				return importSpec{}, fmt.Errorf("invalid header=%q: %w", value, err)
+			}
+			s.header = header
+		default:
+			return importSpec{}, fmt.Errorf("unknown -import field %q", key)
+		}
+	}
+
+	if s.file == "" || s.table == "" {
+		return importSpec{}, errors.New("-import requires file= and table=")
+	}
+
+	if s.format == "" {
+		s.format = importFormatFromExt(s.file)
+	}
+
+	return s, nil
+}
+
+func importFormatFromExt(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".tsv":
+		return formatTSV
+	case ".ndjson", ".jsonl":
+		return formatNDJSON
+	default:
+		return formatCSV
+	}
+}
+
+// runImport streams spec.file into spec.table inside tx, dispatching on format.
+func runImport(ctx context.Context, tx *sql.Tx, spec importSpec, batchSize int, nullString string) error {
+	f, err := os.Open(spec.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch spec.format {
+	case formatCSV:
+		return importDelimited(ctx, tx, f, spec.table, ',', spec.header, batchSize, nullString)
+	case formatTSV:
+		return importDelimited(ctx, tx, f, spec.table, '\t', spec.header, batchSize, nullString)
+	case formatNDJSON:
+		return importNDJSON(ctx, tx, f, spec.table, batchSize, nullString)
+	default:
+		return fmt.Errorf("unsupported -import format %q", spec.format)
+	}
+}
+
+// importDelimited streams CSV/TSV rows from f into table, auto-creating it from
+// the header plus a first-pass type sniff when it does not already exist.
+func importDelimited(ctx context.Context, tx *sql.Tx, f *os.File, table string, comma rune, header bool, batchSize int, nullString string) error {
+	cr := csv.NewReader(f)
+	cr.Comma = comma
+
+	columns, pending, err := delimitedColumns(cr, header)
+	if err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+
+	exists, err := tableExists(ctx, tx, table)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		types, err := sniffDelimitedTypes(cr, pending, len(columns), nullString)
+		if err != nil {
+			return err
+		}
+		if err := createImportedTable(ctx, tx, table, columns, types); err != nil {
+			return err
+		}
+
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		cr = csv.NewReader(f)
+		cr.Comma = comma
+		if columns, pending, err = delimitedColumns(cr, header); err != nil {
+			return fmt.Errorf("reading header: %w", err)
+		}
+	}
+
+	columnTypes, err := tableColumnTypes(ctx, tx, table)
+	if err != nil {
+		return fmt.Errorf("introspecting columns: %w", err)
+	}
+
+	insertStmt, err := tx.PrepareContext(ctx, buildInsertStatement(table, columns))
+	if err != nil {
+		return err
+	}
+	defer insertStmt.Close()
+
+	return importRows(ctx, tx, batchSize, func() ([]any, error) {
+		record := pending
+		if record != nil {
+			pending = nil
+		} else {
+			record, err = cr.Read()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		values := make([]any, len(columns))
+		for i, field := range record {
+			value, err := coerceImportValue(field, columnTypes[columns[i]], nullString)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", columns[i], err)
+			}
+			values[i] = value
+		}
+		return values, nil
+	}, insertStmt)
+}
+
+// delimitedColumns reads the column names for a delimited import: the header
+// row verbatim, or synthetic col1..colN names plus the first data row as
+// pending, when the file has no header.
+func delimitedColumns(cr *csv.Reader, header bool) (columns, pending []string, err error) {
+	first, err := cr.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if header {
+		return first, nil, nil
+	}
+
+	columns = make([]string, len(first))
+	for i := range columns {
+		columns[i] = fmt.Sprintf("col%d", i+1)
+	}
+	return columns, first, nil
+}
+
+// sniffDelimitedTypes scans the remaining rows of cr (starting with pending, if
+// set) to infer an INTEGER/REAL/TEXT affinity for each column.
+func sniffDelimitedTypes(cr *csv.Reader, pending []string, numColumns int, nullString string) ([]string, error) {
+	types := make([]string, numColumns)
+
+	record := pending
+	for {
+		if record == nil {
+			var err error
+			record, err = cr.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for i, field := range record {
+			if i >= numColumns {
+				break
+			}
+			types[i] = widenType(types[i], sniffFieldType(field, nullString))
+		}
+
+		record = nil
+	}
+
+	for i, t := range types {
+		if t == "" {
+			types[i] = "TEXT"
+		}
+	}
+
+	return types, nil
+}
+
+func sniffFieldType(field, nullString string) string {
+	if field == nullString {
+		return ""
+	}
+	if _, err := strconv.ParseInt(field, 10, 64); err == nil {
+		return "INTEGER"
+	}
+	if _, err := strconv.ParseFloat(field, 64); err == nil {
+		return "REAL"
+	}
+	return "TEXT"
+}
+
+// widenType returns the looser of current and observed, treating "" (no
+// information yet, e.g. a NULL field) as absent.
+func widenType(current, observed string) string {
+	if observed == "" {
+		return current
+	}
+	if current == "" {
+		return observed
+	}
+	rank := map[string]int{"INTEGER": 0, "REAL": 1, "TEXT": 2}
+	if rank[observed] > rank[current] {
+		return observed
+	}
+	return current
+}
+
+// importNDJSON streams newline-delimited JSON objects from f into table,
+// auto-creating it from the union of keys plus a first-pass type sniff when it
+// does not already exist.
+func importNDJSON(ctx context.Context, tx *sql.Tx, f *os.File, table string, batchSize int, nullString string) error {
+	columns, types, err := sniffNDJSONSchema(f)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	exists, err := tableExists(ctx, tx, table)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		if err := createImportedTable(ctx, tx, table, columns, types); err != nil {
+			return err
+		}
+	}
+
+	columnTypes, err := tableColumnTypes(ctx, tx, table)
+	if err != nil {
+		return fmt.Errorf("introspecting columns: %w", err)
+	}
+
+	insertStmt, err := tx.PrepareContext(ctx, buildInsertStatement(table, columns))
+	if err != nil {
+		return err
+	}
+	defer insertStmt.Close()
+
+	dec := json.NewDecoder(f)
+	return importRows(ctx, tx, batchSize, func() ([]any, error) {
+		var obj map[string]any
+		if err := dec.Decode(&obj); err != nil {
+			return nil, err
+		}
+
+		values := make([]any, len(columns))
+		for i, name := range columns {
+			value, err := coerceImportValue(obj[name], columnTypes[name], nullString)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", name, err)
+			}
+			values[i] = value
+		}
+		return values, nil
+	}, insertStmt)
+}
+
+// sniffNDJSONSchema scans every object in f to determine its column set, in
+// first-seen order, and an INTEGER/REAL/TEXT affinity for each column.
+func sniffNDJSONSchema(f *os.File) (columns, types []string, err error) {
+	dec := json.NewDecoder(f)
+
+	seen := map[string]bool{}
+	typeByColumn := map[string]string{}
+
+	for {
+		var obj map[string]any
+		if err := dec.Decode(&obj); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		for name, value := range obj {
+			if !seen[name] {
+				seen[name] = true
+				columns = append(columns, name)
+			}
+			typeByColumn[name] = widenType(typeByColumn[name], sniffJSONType(value))
+		}
+	}
+
+	types = make([]string, len(columns))
+	for i, name := range columns {
+		t := typeByColumn[name]
+		if t == "" {
+			t = "TEXT"
+		}
+		types[i] = t
+	}
+
+	return columns, types, nil
+}
+
+func sniffJSONType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case float64:
+		if v == float64(int64(v)) {
+			return "INTEGER"
+		}
+		return "REAL"
+	default:
+		return "TEXT"
+	}
+}
+
+// tableExists reports whether table already exists in the database.
+func tableExists(ctx context.Context, db sqlExecQueryer, table string) (bool, error) {
+	var name string
+	err := db.QueryRowContext(ctx, "SELECT name FROM sqlite_master WHERE type='table' AND name = ?", table).Scan(&name)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return false, nil
+	case err != nil:
+		return false, err
+	default:
+		return true, nil
+	}
+}
+
+// createImportedTable creates table with the given columns and SQLite type
+// affinities, used to auto-create the target of an -import.
+func createImportedTable(ctx context.Context, tx *sql.Tx, table string, columns, types []string) error {
+	defs := make([]string, len(columns))
+	for i, name := range columns {
+		defs[i] = quoteIdent(name) + " " + types[i]
+	}
+
+	_, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdent(table), strings.Join(defs, ", ")))
+	return err
+}
+
+func buildInsertStatement(table string, columns []string) string {
+	quoted := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, name := range columns {
+		quoted[i] = quoteIdent(name)
+		placeholders[i] = "?"
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdent(table), strings.Join(quoted, ", "), strings.Join(placeholders, ", "))
+}
+
+// coerceImportValue maps a raw field value to nil when nullString is set and
+// the value equals it, then coerces it to columnType same as fixture loading
+// does. An empty nullString (the default) disables null substitution
+// entirely, so a blank CSV field or empty JSON string imports as "" rather
+// than silently becoming NULL - except against an INTEGER/REAL column, where
+// "" isn't a valid literal at all (sniffFieldType treats it as "no signal",
+// not as TEXT) and coercing it would just error; there it always means NULL.
+func coerceImportValue(value any, columnType, nullString string) (any, error) {
+	if s, ok := value.(string); ok {
+		if s == "" && (strings.Contains(columnType, "INT") ||
+			strings.Contains(columnType, "REAL") || strings.Contains(columnType, "FLOA") || strings.Contains(columnType, "DOUB")) {
+			return nil, nil
+		}
+		if nullString != "" && s == nullString {
+			return nil, nil
+		}
+	}
+	return coerceFixtureValue(value, columnType)
+}
+
+// importRows calls next for each row to insert until it returns io.EOF,
+// wrapping every batchSize rows in a SAVEPOINT so a large import doesn't grow
+// the transaction's journal unbounded.
+func importRows(ctx context.Context, tx *sql.Tx, batchSize int, next func() ([]any, error), insert *sql.Stmt) error {
+	const savepoint = "sql3effect_import"
+
+	count := 0
+	for {
+		values, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if count%batchSize == 0 {
+			if count > 0 {
+				if _, err := tx.ExecContext(ctx, "RELEASE "+savepoint); err != nil {
+					return fmt.Errorf("release savepoint: %w", err)
+				}
+			}
+			if _, err := tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+				return fmt.Errorf("savepoint: %w", err)
+			}
+		}
+
+		if _, err := insert.ExecContext(ctx, values...); err != nil {
+			return fmt.Errorf("inserting row %d: %w", count+1, err)
+		}
+
+		count++
+	}
+
+	if count > 0 {
+		if _, err := tx.ExecContext(ctx, "RELEASE "+savepoint); err != nil {
+			return fmt.Errorf("release savepoint: %w", err)
+		}
 	}
 
-	return errors.Join(
-		rows.Err(),
-		tw.Render(),
-	)
+	return nil
 }
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLooksLikeQuery(t *testing.T) {
+	cases := []struct {
+		statement string
+		want      bool
+	}{
+		{statement: "SELECT 1", want: true},
+		{statement: "  select * from t", want: true},
+		{statement: "WITH t AS (SELECT 1) SELECT * FROM t", want: true},
+		{statement: "PRAGMA table_info(t)", want: true},
+		{statement: "EXPLAIN QUERY PLAN SELECT 1", want: true},
+		{statement: "VALUES (1), (2)", want: true},
+		{statement: "INSERT INTO t VALUES (1)", want: false},
+		{statement: "UPDATE t SET a = 1", want: false},
+		{statement: "DELETE FROM t", want: false},
+		{statement: "CREATE TABLE t(a)", want: false},
+		{statement: "", want: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.statement, func(t *testing.T) {
+			if got := looksLikeQuery(c.statement); got != c.want {
+				t.Fatalf("looksLikeQuery(%q) = %v, want %v", c.statement, got, c.want)
+			}
+		})
+	}
+}
+
+func TestCoerceFixtureValue(t *testing.T) {
+	cases := []struct {
+		name       string
+		value      any
+		columnType string
+		want       any
+		wantErr    bool
+	}{
+		{name: "nil stays nil", value: nil, columnType: "INTEGER", want: nil},
+		{name: "quoted integer", value: "10", columnType: "INTEGER", want: int64(10)},
+		{name: "native integer passes through", value: int64(10), columnType: "INTEGER", want: int64(10)},
+		{name: "bad integer", value: "abc", columnType: "INTEGER", wantErr: true},
+		{name: "quoted real", value: "1.5", columnType: "REAL", want: float64(1.5)},
+		{name: "float column type", value: "1.5", columnType: "FLOAT", want: float64(1.5)},
+		{name: "double column type", value: "1.5", columnType: "DOUBLE", want: float64(1.5)},
+		{name: "bad real", value: "abc", columnType: "REAL", wantErr: true},
+		{name: "string to blob", value: "abc", columnType: "BLOB", want: []byte("abc")},
+		{name: "text passes through", value: "abc", columnType: "TEXT", want: "abc"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := coerceFixtureValue(c.value, c.columnType)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("coerceFixtureValue(%v, %q) = %v, want error", c.value, c.columnType, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("coerceFixtureValue(%v, %q) unexpected error: %v", c.value, c.columnType, err)
+			}
+
+			switch want := c.want.(type) {
+			case []byte:
+				gotBytes, ok := got.([]byte)
+				if !ok || string(gotBytes) != string(want) {
+					t.Fatalf("coerceFixtureValue(%v, %q) = %v, want %v", c.value, c.columnType, got, c.want)
+				}
+			default:
+				if got != c.want {
+					t.Fatalf("coerceFixtureValue(%v, %q) = %v, want %v", c.value, c.columnType, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCoerceImportValue(t *testing.T) {
+	cases := []struct {
+		name       string
+		value      any
+		columnType string
+		nullString string
+		want       any
+		wantErr    bool
+	}{
+		{name: "blank integer field is null", value: "", columnType: "INTEGER", want: nil},
+		{name: "blank real field is null", value: "", columnType: "REAL", want: nil},
+		{name: "blank text field stays empty string", value: "", columnType: "TEXT", want: ""},
+		{name: "non-blank integer field still parses", value: "30", columnType: "INTEGER", want: int64(30)},
+		{name: "configured null string still applies", value: "NA", columnType: "TEXT", nullString: "NA", want: nil},
+		{name: "bad integer field still errors", value: "abc", columnType: "INTEGER", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := coerceImportValue(c.value, c.columnType, c.nullString)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("coerceImportValue(%v, %q, %q) = %v, want error", c.value, c.columnType, c.nullString, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("coerceImportValue(%v, %q, %q) unexpected error: %v", c.value, c.columnType, c.nullString, err)
+			}
+			if got != c.want {
+				t.Fatalf("coerceImportValue(%v, %q, %q) = %v, want %v", c.value, c.columnType, c.nullString, got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseImportSpec(t *testing.T) {
+	cases := []struct {
+		name    string
+		spec    string
+		want    importSpec
+		wantErr bool
+	}{
+		{
+			name: "format inferred from extension",
+			spec: "file=data.csv,table=t",
+			want: importSpec{file: "data.csv", table: "t", format: formatCSV, header: true},
+		},
+		{
+			name: "explicit format overrides extension",
+			spec: "file=data.csv,table=t,format=tsv",
+			want: importSpec{file: "data.csv", table: "t", format: formatTSV, header: true},
+		},
+		{
+			name: "header=false",
+			spec: "file=data.csv,table=t,header=false",
+			want: importSpec{file: "data.csv", table: "t", format: formatCSV, header: false},
+		},
+		{name: "missing file", spec: "table=t", wantErr: true},
+		{name: "missing table", spec: "file=data.csv", wantErr: true},
+		{name: "invalid field", spec: "file=data.csv,table=t,bogus=1", wantErr: true},
+		{name: "not key=value", spec: "file=data.csv,table", wantErr: true},
+		{name: "invalid header", spec: "file=data.csv,table=t,header=nope", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := parseImportSpec(c.spec)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("parseImportSpec(%q) = %+v, want error", c.spec, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseImportSpec(%q) unexpected error: %v", c.spec, err)
+			}
+			if got != c.want {
+				t.Fatalf("parseImportSpec(%q) = %+v, want %+v", c.spec, got, c.want)
+			}
+		})
+	}
+}
+
+func TestSniffFieldType(t *testing.T) {
+	cases := []struct {
+		field      string
+		nullString string
+		want       string
+	}{
+		{field: "", nullString: "", want: ""},
+		{field: "NULL", nullString: "NULL", want: ""},
+		{field: "10", nullString: "", want: "INTEGER"},
+		{field: "-10", nullString: "", want: "INTEGER"},
+		{field: "1.5", nullString: "", want: "REAL"},
+		{field: "abc", nullString: "", want: "TEXT"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.field, func(t *testing.T) {
+			if got := sniffFieldType(c.field, c.nullString); got != c.want {
+				t.Fatalf("sniffFieldType(%q, %q) = %q, want %q", c.field, c.nullString, got, c.want)
+			}
+		})
+	}
+}
+
+func TestWidenType(t *testing.T) {
+	cases := []struct {
+		current, observed, want string
+	}{
+		{current: "", observed: "", want: ""},
+		{current: "", observed: "INTEGER", want: "INTEGER"},
+		{current: "INTEGER", observed: "", want: "INTEGER"},
+		{current: "INTEGER", observed: "REAL", want: "REAL"},
+		{current: "REAL", observed: "INTEGER", want: "REAL"},
+		{current: "INTEGER", observed: "TEXT", want: "TEXT"},
+		{current: "TEXT", observed: "INTEGER", want: "TEXT"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.current+"/"+c.observed, func(t *testing.T) {
+			if got := widenType(c.current, c.observed); got != c.want {
+				t.Fatalf("widenType(%q, %q) = %q, want %q", c.current, c.observed, got, c.want)
+			}
+		})
+	}
+}
+
+func TestBackupTo(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	srcFile := filepath.Join(dir, "src.db")
+	destFile := filepath.Join(dir, "dest.db")
+
+	src, err := sql.Open("sqlite3", "file:"+srcFile)
+	if err != nil {
+		t.Fatalf("opening source: %v", err)
+	}
+	defer src.Close()
+
+	if _, err := src.ExecContext(ctx, "CREATE TABLE t (a INTEGER)"); err != nil {
+		t.Fatalf("creating table: %v", err)
+	}
+	if _, err := src.ExecContext(ctx, "INSERT INTO t VALUES (1), (2), (3)"); err != nil {
+		t.Fatalf("inserting rows: %v", err)
+	}
+
+	if err := backupTo(ctx, src, destFile); err != nil {
+		t.Fatalf("backupTo: %v", err)
+	}
+
+	dest, err := sql.Open("sqlite3", "file:"+destFile)
+	if err != nil {
+		t.Fatalf("opening destination: %v", err)
+	}
+	defer dest.Close()
+
+	var count int
+	if err := dest.QueryRowContext(ctx, "SELECT count(*) FROM t").Scan(&count); err != nil {
+		t.Fatalf("querying backup: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("backup has %d rows, want 3", count)
+	}
+}
+
+func TestRestoreFrom(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	srcFile := filepath.Join(dir, "src.db")
+	destFile := filepath.Join(dir, "dest.db")
+
+	src, err := sql.Open("sqlite3", "file:"+srcFile)
+	if err != nil {
+		t.Fatalf("opening source: %v", err)
+	}
+	if _, err := src.ExecContext(ctx, "CREATE TABLE t (a INTEGER)"); err != nil {
+		t.Fatalf("creating table: %v", err)
+	}
+	if _, err := src.ExecContext(ctx, "INSERT INTO t VALUES (1), (2)"); err != nil {
+		t.Fatalf("inserting rows: %v", err)
+	}
+	if err := src.Close(); err != nil {
+		t.Fatalf("closing source: %v", err)
+	}
+
+	if err := restoreFrom(ctx, srcFile, destFile); err != nil {
+		t.Fatalf("restoreFrom: %v", err)
+	}
+
+	dest, err := sql.Open("sqlite3", "file:"+destFile)
+	if err != nil {
+		t.Fatalf("opening destination: %v", err)
+	}
+	defer dest.Close()
+
+	var count int
+	if err := dest.QueryRowContext(ctx, "SELECT count(*) FROM t").Scan(&count); err != nil {
+		t.Fatalf("querying restored db: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("restored db has %d rows, want 2", count)
+	}
+}
+
+func TestRegisterPluginsJS(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "db.sqlite")
+	scriptFile := filepath.Join(dir, "double.js")
+
+	if err := os.WriteFile(scriptFile, []byte("function Scalar(x) { return x * 2; }"), 0o644); err != nil {
+		t.Fatalf("writing script: %v", err)
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+dbFile)
+	if err != nil {
+		t.Fatalf("opening db: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	jsPlugins := []pluginSpec{{name: "dbl", path: scriptFile}}
+	if err := registerPlugins(ctx, db, nil, jsPlugins); err != nil {
+		t.Fatalf("registerPlugins: %v", err)
+	}
+
+	var result int64
+	if err := db.QueryRowContext(ctx, "SELECT dbl(21)").Scan(&result); err != nil {
+		t.Fatalf("calling registered function: %v", err)
+	}
+	if result != 42 {
+		t.Fatalf("dbl(21) = %d, want 42", result)
+	}
+}